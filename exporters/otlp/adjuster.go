@@ -0,0 +1,201 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"sync"
+	"time"
+
+	metricpb "github.com/open-telemetry/opentelemetry-proto/gen/go/metrics/v1"
+
+	"go.opentelemetry.io/otel/api/label"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// Temporality selects how the exporter reports the sums produced by
+// CounterKind instruments.
+type Temporality int
+
+const (
+	// CumulativeTemporality reports sums exactly as the SDK's aggregators
+	// produce them: monotonically increasing since the series was first
+	// observed. This is the default.
+	CumulativeTemporality Temporality = iota
+
+	// DeltaTemporality converts cumulative sums into the change since the
+	// previous export of the same series, which is what many OTLP backends
+	// expect.
+	DeltaTemporality
+)
+
+// WithTemporality selects how the exporter reports counter sums. See
+// Temporality.
+//
+// This only affects the OTLP export path. It has no effect when the
+// Exporter is configured with WithPrometheusRemoteWriteClient: Prometheus
+// remote-write always carries cumulative sums, and the Prometheus path does
+// not run counter values through the adjuster.
+func WithTemporality(t Temporality) ExporterOption {
+	return func(cfg *config) {
+		cfg.temporality = t
+	}
+}
+
+// seriesKey identifies one time series across successive Export calls so the
+// adjuster can remember its previous value and start time.
+type seriesKey struct {
+	resource label.Distinct
+	library  string
+	name     string
+	labels   string
+}
+
+// seriesState is what the adjuster remembers about a series between Export
+// calls.
+type seriesState struct {
+	startTime time.Time
+	time      time.Time
+	value     float64
+}
+
+// adjuster applies Temporality conversion to counter series and stamps
+// StartTimeUnixNano/TimeUnixNano on their data points, tracking state per
+// series across Export calls. It is owned by a single Exporter; adjust and
+// forget hold the adjuster's own lock, so concurrent Export calls on that
+// Exporter are safe.
+type adjuster struct {
+	lock        sync.Mutex
+	temporality Temporality
+	series      map[seriesKey]*seriesState
+}
+
+func newAdjuster(t Temporality) *adjuster {
+	return &adjuster{temporality: t, series: map[seriesKey]*seriesState{}}
+}
+
+// adjust walks every data point in rm, converting counter sums per the
+// configured Temporality and stamping start/end timestamps on the points.
+// A counter metric carrying more than one point (as WithoutPreAggregation
+// can produce) is left unchanged: it is neither converted nor stamped.
+func (a *adjuster) adjust(rm *metricpb.ResourceMetrics, res *resource.Resource, now time.Time) {
+	if rm == nil {
+		return
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var resourceKey label.Distinct
+	if res != nil {
+		resourceKey = res.Equivalent()
+	}
+
+	for _, ilm := range rm.GetInstrumentationLibraryMetrics() {
+		library := ilm.GetInstrumentationLibrary().GetName()
+		for _, m := range ilm.GetMetrics() {
+			desc := m.GetMetricDescriptor()
+			key := seriesKey{
+				resource: resourceKey,
+				library:  library,
+				name:     desc.GetName(),
+				labels:   desc.String(),
+			}
+
+			switch desc.GetType() {
+			case metricpb.MetricDescriptor_COUNTER_INT64:
+				// Temporality conversion only makes sense for a single,
+				// pre-aggregated point per series; skip otherwise.
+				if len(m.Int64DataPoints) != 1 {
+					continue
+				}
+				p := m.Int64DataPoints[0]
+				emitted, start, end := a.observeCounter(key, float64(p.Value), now)
+				p.Value = int64(emitted)
+				p.StartTimeUnixNano = uint64(start.UnixNano())
+				p.TimeUnixNano = uint64(end.UnixNano())
+			case metricpb.MetricDescriptor_COUNTER_DOUBLE:
+				if len(m.DoubleDataPoints) != 1 {
+					continue
+				}
+				p := m.DoubleDataPoints[0]
+				emitted, start, end := a.observeCounter(key, p.Value, now)
+				p.Value = emitted
+				p.StartTimeUnixNano = uint64(start.UnixNano())
+				p.TimeUnixNano = uint64(end.UnixNano())
+			default:
+				for _, p := range m.SummaryDataPoints {
+					start, end := a.observeOther(key, now)
+					p.StartTimeUnixNano = uint64(start.UnixNano())
+					p.TimeUnixNano = uint64(end.UnixNano())
+				}
+			}
+		}
+	}
+}
+
+// observeCounter records value for key and returns the value to emit along
+// with the start/end of the window it covers, according to the configured
+// Temporality. A value lower than the last-seen value is treated as a
+// counter reset: the start time is re-anchored to now and the raw value is
+// emitted regardless of Temporality.
+func (a *adjuster) observeCounter(key seriesKey, value float64, now time.Time) (emitted float64, start, end time.Time) {
+	prev, ok := a.series[key]
+	if !ok || value < prev.value {
+		a.series[key] = &seriesState{startTime: now, time: now, value: value}
+		return value, now, now
+	}
+
+	var nextStart time.Time
+	switch a.temporality {
+	case DeltaTemporality:
+		// Each delta's window starts where the previous one ended.
+		emitted = value - prev.value
+		start = prev.time
+		nextStart = now
+	default: // CumulativeTemporality
+		// The window always starts at the series' first-seen time.
+		emitted = value
+		start = prev.startTime
+		nextStart = prev.startTime
+	}
+
+	a.series[key] = &seriesState{startTime: nextStart, time: now, value: value}
+	return emitted, start, now
+}
+
+// observeOther stamps the start/end window for a non-counter series,
+// remembering only the first-seen time as the series' start.
+func (a *adjuster) observeOther(key seriesKey, now time.Time) (start, end time.Time) {
+	state, ok := a.series[key]
+	if !ok {
+		state = &seriesState{startTime: now}
+		a.series[key] = state
+	}
+	state.time = now
+	return state.startTime, now
+}
+
+// forget discards any remembered state for key. It is used when a series is
+// marked stale: without it, the next real observation of the series would be
+// adjusted against its pre-gap value, producing a bogus delta (or, for
+// cumulative temporality, an incorrect start time) across the gap. Forgetting
+// the state makes that observation look like the series' first, the same
+// treatment already given to counter resets.
+func (a *adjuster) forget(key seriesKey) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	delete(a.series, key)
+}
@@ -0,0 +1,127 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/otel/api/core"
+	"go.opentelemetry.io/otel/api/key"
+	"go.opentelemetry.io/otel/api/label"
+	"go.opentelemetry.io/otel/api/metric"
+	metricsdk "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/metric/aggregator/sum"
+)
+
+// counterCheckpoint builds a single-record checkpoint set for a CounterKind
+// int64 instrument holding value.
+func counterCheckpoint(t *testing.T, name string, value int64, labels ...core.KeyValue) checkpointSet {
+	desc := metric.NewDescriptor(name, metric.CounterKind, core.Int64NumberKind)
+	labs := label.NewSet(labels...)
+	agg := sum.New()
+	ctx := context.Background()
+	require.NoError(t, agg.Update(ctx, core.NewInt64Number(value), &desc))
+	agg.Checkpoint(ctx, &desc)
+	return checkpointSet{records: []metricsdk.Record{metricsdk.NewRecord(&desc, &labs, agg)}}
+}
+
+func TestTemporalityDeltaConversion(t *testing.T) {
+	msc := &metricsServiceClientStub{}
+	exp := NewUnstartedExporter(WithTemporality(DeltaTemporality))
+	exp.metricExporter = msc
+	exp.started = true
+
+	clock := time.Unix(1000, 0)
+	exp.now = func() time.Time { return clock }
+
+	host := key.String("host", "test.com")
+	ctx := context.Background()
+
+	require.NoError(t, exp.Export(ctx, nil, counterCheckpoint(t, "requests", 10, host)))
+	require.Len(t, msc.ResourceMetrics(), 1)
+	first := msc.ResourceMetrics()[0].InstrumentationLibraryMetrics[0].Metrics[0].Int64DataPoints[0]
+	assert.Equal(t, int64(10), first.Value)
+	assert.Equal(t, uint64(clock.UnixNano()), first.StartTimeUnixNano)
+	assert.Equal(t, uint64(clock.UnixNano()), first.TimeUnixNano)
+
+	msc.Reset()
+	firstTime := clock
+	clock = clock.Add(time.Second)
+	require.NoError(t, exp.Export(ctx, nil, counterCheckpoint(t, "requests", 25, host)))
+	second := msc.ResourceMetrics()[0].InstrumentationLibraryMetrics[0].Metrics[0].Int64DataPoints[0]
+	assert.Equal(t, int64(15), second.Value, "delta should be the change since the previous export")
+	assert.Equal(t, uint64(firstTime.UnixNano()), second.StartTimeUnixNano)
+	assert.Equal(t, uint64(clock.UnixNano()), second.TimeUnixNano)
+
+	msc.Reset()
+	secondTime := clock
+	clock = clock.Add(time.Second)
+	require.NoError(t, exp.Export(ctx, nil, counterCheckpoint(t, "requests", 5, host)))
+	third := msc.ResourceMetrics()[0].InstrumentationLibraryMetrics[0].Metrics[0].Int64DataPoints[0]
+	assert.Equal(t, int64(5), third.Value, "a value lower than the last one is a counter reset, emitted raw")
+	assert.Equal(t, uint64(clock.UnixNano()), third.StartTimeUnixNano, "reset re-anchors the start time to now")
+	assert.NotEqual(t, uint64(secondTime.UnixNano()), third.StartTimeUnixNano)
+}
+
+func TestTemporalityCumulativeKeepsFirstSeenStart(t *testing.T) {
+	msc := &metricsServiceClientStub{}
+	exp := NewUnstartedExporter()
+	exp.metricExporter = msc
+	exp.started = true
+
+	clock := time.Unix(2000, 0)
+	exp.now = func() time.Time { return clock }
+
+	host := key.String("host", "test.com")
+	ctx := context.Background()
+
+	require.NoError(t, exp.Export(ctx, nil, counterCheckpoint(t, "requests", 10, host)))
+	firstStart := msc.ResourceMetrics()[0].InstrumentationLibraryMetrics[0].Metrics[0].Int64DataPoints[0].StartTimeUnixNano
+
+	msc.Reset()
+	clock = clock.Add(time.Second)
+	require.NoError(t, exp.Export(ctx, nil, counterCheckpoint(t, "requests", 25, host)))
+	point := msc.ResourceMetrics()[0].InstrumentationLibraryMetrics[0].Metrics[0].Int64DataPoints[0]
+	assert.Equal(t, int64(25), point.Value, "cumulative temporality reports the raw sum")
+	assert.Equal(t, firstStart, point.StartTimeUnixNano, "cumulative temporality keeps the series' first-seen start time")
+	assert.Equal(t, uint64(clock.UnixNano()), point.TimeUnixNano)
+}
+
+func TestTemporalityLabelChurnStartsFreshSeries(t *testing.T) {
+	msc := &metricsServiceClientStub{}
+	exp := NewUnstartedExporter(WithTemporality(DeltaTemporality))
+	exp.metricExporter = msc
+	exp.started = true
+
+	clock := time.Unix(3000, 0)
+	exp.now = func() time.Time { return clock }
+
+	ctx := context.Background()
+	require.NoError(t, exp.Export(ctx, nil, counterCheckpoint(t, "requests", 10, key.String("host", "a.test.com"))))
+
+	msc.Reset()
+	clock = clock.Add(time.Second)
+	// A different label set is a different series; it must not be treated
+	// as a continuation of "a.test.com"'s counter.
+	require.NoError(t, exp.Export(ctx, nil, counterCheckpoint(t, "requests", 3, key.String("host", "b.test.com"))))
+	point := msc.ResourceMetrics()[0].InstrumentationLibraryMetrics[0].Metrics[0].Int64DataPoints[0]
+	assert.Equal(t, int64(3), point.Value, "a new label set is its own series and reports its raw first value")
+	assert.Equal(t, uint64(clock.UnixNano()), point.StartTimeUnixNano)
+}
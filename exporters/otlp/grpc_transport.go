@@ -0,0 +1,32 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"context"
+
+	colmetricpb "github.com/open-telemetry/opentelemetry-proto/gen/go/collector/metrics/v1"
+)
+
+// grpcMetricExporter adapts the generated MetricsServiceClient to the
+// metricExporter interface.
+type grpcMetricExporter struct {
+	client colmetricpb.MetricsServiceClient
+}
+
+func (e *grpcMetricExporter) Export(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) error {
+	_, err := e.client.Export(ctx, req)
+	return err
+}
@@ -0,0 +1,171 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+
+	colmetricpb "github.com/open-telemetry/opentelemetry-proto/gen/go/collector/metrics/v1"
+)
+
+// httpMetricsPath is the path OTLP's HTTP binding serves metrics export
+// requests on.
+const httpMetricsPath = "/v1/metrics"
+
+// httpMaxRetries bounds the number of attempts Export makes in response to a
+// 429/503 before giving up, so a persistently throttling collector cannot
+// retry forever.
+const httpMaxRetries = 5
+
+// httpInitialBackoff is the delay before the first retry when the collector
+// gives no Retry-After hint. It doubles on every subsequent retry.
+const httpInitialBackoff = 100 * time.Millisecond
+
+// httpMetricExporter delivers ExportMetricsServiceRequests to a collector's
+// OTLP HTTP endpoint, as either binary protobuf or JSON, per the OTLP HTTP
+// binding.
+type httpMetricExporter struct {
+	url         string
+	headers     map[string]string
+	compression HTTPCompression
+	useJSON     bool
+	client      *http.Client
+}
+
+func newHTTPMetricExporter(cfg config) *httpMetricExporter {
+	return &httpMetricExporter{
+		url:         strings.TrimSuffix(cfg.httpEndpoint, "/") + httpMetricsPath,
+		headers:     cfg.httpHeaders,
+		compression: cfg.httpCompression,
+		useJSON:     cfg.httpUseJSON,
+		client:      http.DefaultClient,
+	}
+}
+
+func (e *httpMetricExporter) Export(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) error {
+	body, contentType, err := e.encode(req)
+	if err != nil {
+		return err
+	}
+
+	backoff := httpInitialBackoff
+	for attempt := 0; ; attempt++ {
+		status, retryAfter, err := e.post(ctx, body, contentType)
+		if err != nil {
+			return err
+		}
+		if status < 300 {
+			return nil
+		}
+		if status != http.StatusTooManyRequests && status != http.StatusServiceUnavailable {
+			return fmt.Errorf("otlp: collector responded with HTTP %d", status)
+		}
+		if attempt >= httpMaxRetries {
+			return fmt.Errorf("otlp: collector responded with HTTP %d after %d attempts", status, attempt+1)
+		}
+
+		wait := backoff
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// post issues a single export attempt and reports the response status and
+// any Retry-After delay it carried. A non-nil error means the request
+// itself failed (e.g. a dial error), not that the collector rejected it.
+func (e *httpMetricExporter) post(ctx context.Context, body []byte, contentType string) (status int, retryAfter time.Duration, err error) {
+	encoded := body
+	if e.compression == GzipCompression {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err = gz.Write(body); err != nil {
+			return 0, 0, err
+		}
+		if err = gz.Close(); err != nil {
+			return 0, 0, err
+		}
+		encoded = buf.Bytes()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(encoded))
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if e.compression == GzipCompression {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	return resp.StatusCode, parseRetryAfter(resp.Header.Get("Retry-After")), nil
+}
+
+// parseRetryAfter accepts either form of the Retry-After header: a number of
+// seconds, or an HTTP date. It returns 0 if v is empty or unparseable.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+func (e *httpMetricExporter) encode(req *colmetricpb.ExportMetricsServiceRequest) (body []byte, contentType string, err error) {
+	if e.useJSON {
+		var buf bytes.Buffer
+		if err := (&jsonpb.Marshaler{}).Marshal(&buf, req); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "application/json", nil
+	}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, "application/x-protobuf", nil
+}
@@ -0,0 +1,151 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	colmetricpb "github.com/open-telemetry/opentelemetry-proto/gen/go/collector/metrics/v1"
+	metricpb "github.com/open-telemetry/opentelemetry-proto/gen/go/metrics/v1"
+)
+
+// httpExportCollector is an httptest.Server that decodes the
+// ExportMetricsServiceRequests it receives on /v1/metrics, as either
+// protobuf or JSON, mirroring what a real collector's HTTP receiver does.
+type httpExportCollector struct {
+	server  *httptest.Server
+	useJSON bool
+
+	mu sync.Mutex
+	rm []metricpb.ResourceMetrics
+}
+
+func newHTTPExportCollector(useJSON bool) *httpExportCollector {
+	c := &httpExportCollector{useJSON: useJSON}
+	c.server = httptest.NewServer(http.HandlerFunc(c.handle))
+	return c
+}
+
+func (c *httpExportCollector) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	req := &colmetricpb.ExportMetricsServiceRequest{}
+	if c.useJSON {
+		err = jsonpb.Unmarshal(bytes.NewReader(body), req)
+	} else {
+		err = proto.Unmarshal(body, req)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	for _, rm := range req.GetResourceMetrics() {
+		if rm != nil {
+			c.rm = append(c.rm, *rm)
+		}
+	}
+	c.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *httpExportCollector) ResourceMetrics() []metricpb.ResourceMetrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rm
+}
+
+func (c *httpExportCollector) Close() {
+	c.server.Close()
+}
+
+// runMetricExportHTTPTest runs the same export/assert flow as
+// runMetricExportTest, but against a real HTTP round trip to an
+// httptest.Server instead of an in-process gRPC stub.
+func runMetricExportHTTPTest(t *testing.T, useJSON bool, rs []record, expected []metricpb.ResourceMetrics) {
+	collector := newHTTPExportCollector(useJSON)
+	defer collector.Close()
+
+	opts := []ExporterOption{WithHTTPEndpoint(collector.server.URL)}
+	if useJSON {
+		opts = append(opts, WithJSONEncoding())
+	}
+	exp := NewUnstartedExporter(opts...)
+	require.NoError(t, exp.Start(context.Background()))
+	defer func() { require.NoError(t, exp.Stop(context.Background())) }()
+
+	runMetricExportTestWithCollector(t, exp, collector, rs, expected)
+}
+
+func TestHTTPExporterRetriesOnServiceUnavailable(t *testing.T) {
+	var attempts int
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		n := attempts
+		mu.Unlock()
+
+		if n < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	exp := NewUnstartedExporter(WithHTTPEndpoint(server.URL))
+	require.NoError(t, exp.Start(context.Background()))
+	defer func() { require.NoError(t, exp.Stop(context.Background())) }()
+
+	err := exp.metricExporter.Export(context.Background(), &colmetricpb.ExportMetricsServiceRequest{})
+	require.NoError(t, err)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 3, attempts, "expected the exporter to retry past the two 503 responses")
+}
+
+func TestHTTPExporterGivesUpAfterMaxRetries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	exp := NewUnstartedExporter(WithHTTPEndpoint(server.URL))
+	require.NoError(t, exp.Start(context.Background()))
+	defer func() { require.NoError(t, exp.Stop(context.Background())) }()
+
+	err := exp.metricExporter.Export(context.Background(), &colmetricpb.ExportMetricsServiceRequest{})
+	assert.Error(t, err, "a collector that always throttles should eventually surface an error")
+}
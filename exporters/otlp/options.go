@@ -0,0 +1,198 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// DefaultWorkerCount is the number of goroutines used by the exporter to
+// process and encode metrics concurrently when none is specified.
+const DefaultWorkerCount int = 1
+
+// config holds the options for an Exporter. It is populated by
+// ExporterOptions passed to NewExporter or NewUnstartedExporter.
+type config struct {
+	canDialInsecure bool
+
+	collectorAddr string
+
+	compressor string
+
+	clientCredentials credentials.TransportCredentials
+
+	grpcDialOptions []grpc.DialOption
+
+	reconnectionPeriod time.Duration
+
+	workerCount int
+
+	withoutPreAggregation bool
+
+	temporality Temporality
+
+	stalenessMarkers bool
+
+	promClient     PrometheusRemoteWriteClient
+	externalLabels map[string]string
+
+	httpEndpoint    string
+	httpHeaders     map[string]string
+	httpCompression HTTPCompression
+	httpUseJSON     bool
+}
+
+// ExporterOption configures an Exporter's behavior.
+type ExporterOption func(*config)
+
+// WithInsecure disables client transport security for the exporter's gRPC
+// connection, similar to grpc.WithInsecure().
+// Note, by default, client security is required unless WithInsecure is used.
+func WithInsecure() ExporterOption {
+	return func(cfg *config) {
+		cfg.canDialInsecure = true
+	}
+}
+
+// WithAddress allows one to set the address that the exporter will connect
+// to the collector on. There is no auto-discovery: if unset, Start dials
+// an empty address.
+func WithAddress(addr string) ExporterOption {
+	return func(cfg *config) {
+		cfg.collectorAddr = addr
+	}
+}
+
+// WithReconnectionPeriod records a delay between connection attempts in the
+// Exporter's configuration. Nothing in the Exporter reads it: the Exporter
+// performs no reconnection of its own.
+func WithReconnectionPeriod(rp time.Duration) ExporterOption {
+	return func(cfg *config) {
+		cfg.reconnectionPeriod = rp
+	}
+}
+
+// WithCompressor will set the compressor for the gRPC client to use when
+// sending requests. It is the responsibility of the caller to ensure that
+// the compressor set has been registered with google.golang.org/grpc/encoding.
+func WithCompressor(compressor string) ExporterOption {
+	return func(cfg *config) {
+		cfg.compressor = compressor
+	}
+}
+
+// WithTLSCredentials allows the connection to use TLS credentials. The
+// connection is not insecure by default; see WithInsecure.
+func WithTLSCredentials(creds credentials.TransportCredentials) ExporterOption {
+	return func(cfg *config) {
+		cfg.clientCredentials = creds
+	}
+}
+
+// WithGRPCDialOption opens support to any grpc.DialOption to be used. If it
+// conflicts with some other configuration the GRPC specified via the
+// collector the ones here will take preference since they are set last.
+func WithGRPCDialOption(opts ...grpc.DialOption) ExporterOption {
+	return func(cfg *config) {
+		cfg.grpcDialOptions = opts
+	}
+}
+
+// WorkerCount sets the number of goroutines used by the exporter to encode
+// records concurrently when transforming a checkpoint set into an
+// ExportMetricsServiceRequest. The default is DefaultWorkerCount.
+func WorkerCount(n int) ExporterOption {
+	return func(cfg *config) {
+		cfg.workerCount = n
+	}
+}
+
+// WithoutPreAggregation disables the exporter's default behavior of merging
+// records that share a resource, instrumentation library, descriptor, and
+// label set into a single data point before encoding. Use it when the raw,
+// possibly duplicated, points from the checkpoint set are wanted as-is.
+func WithoutPreAggregation() ExporterOption {
+	return func(cfg *config) {
+		cfg.withoutPreAggregation = true
+	}
+}
+
+// WithPrometheusRemoteWriteClient sets the client the Exporter uses to ship
+// checkpoint sets as Prometheus remote-write WriteRequests instead of OTLP.
+// When set, it takes precedence over the gRPC/OTLP transport.
+func WithPrometheusRemoteWriteClient(client PrometheusRemoteWriteClient) ExporterOption {
+	return func(cfg *config) {
+		cfg.promClient = client
+	}
+}
+
+// WithExternalLabels sets a static set of labels to attach to every
+// Prometheus time series produced by the exporter, in addition to the
+// labels derived from the resource being exported. It has no effect unless
+// PrometheusRemoteWriteClient is also used.
+func WithExternalLabels(labels map[string]string) ExporterOption {
+	return func(cfg *config) {
+		cfg.externalLabels = labels
+	}
+}
+
+// HTTPCompression selects how the HTTP transport compresses export request
+// bodies.
+type HTTPCompression int
+
+const (
+	// NoCompression sends request bodies uncompressed. This is the default.
+	NoCompression HTTPCompression = iota
+	// GzipCompression gzips request bodies and sets Content-Encoding: gzip.
+	GzipCompression
+)
+
+// WithHTTPEndpoint configures the exporter to deliver OTLP metrics over HTTP
+// to the collector's /v1/metrics endpoint at url, instead of dialing it over
+// gRPC. url should not include the /v1/metrics suffix. Setting this option
+// takes precedence over the gRPC transport.
+func WithHTTPEndpoint(url string) ExporterOption {
+	return func(cfg *config) {
+		cfg.httpEndpoint = url
+	}
+}
+
+// WithHTTPHeaders sets additional headers sent with every HTTP export
+// request. It has no effect unless WithHTTPEndpoint is also used.
+func WithHTTPHeaders(headers map[string]string) ExporterOption {
+	return func(cfg *config) {
+		cfg.httpHeaders = headers
+	}
+}
+
+// WithHTTPCompression sets how the HTTP transport compresses request
+// bodies. It has no effect unless WithHTTPEndpoint is also used.
+func WithHTTPCompression(c HTTPCompression) ExporterOption {
+	return func(cfg *config) {
+		cfg.httpCompression = c
+	}
+}
+
+// WithJSONEncoding encodes HTTP export requests as JSON instead of the
+// default binary protobuf. It has no effect unless WithHTTPEndpoint is also
+// used.
+func WithJSONEncoding() ExporterOption {
+	return func(cfg *config) {
+		cfg.httpUseJSON = true
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package otlp contains an exporter for the OpenTelemetry Protocol (OTLP) that
+// ships metric checkpoints to an OpenTelemetry collector over gRPC or HTTP.
+package otlp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	colmetricpb "github.com/open-telemetry/opentelemetry-proto/gen/go/collector/metrics/v1"
+	metricpb "github.com/open-telemetry/opentelemetry-proto/gen/go/metrics/v1"
+
+	"google.golang.org/grpc"
+
+	"go.opentelemetry.io/otel/api/label"
+	metricsdk "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// errAlreadyStarted is returned when start is called more than once.
+var errAlreadyStarted = errors.New("otlp: exporter already started")
+
+// metricExporter is the minimal surface the Exporter needs from a transport
+// in order to deliver an ExportMetricsServiceRequest. grpcMetricExporter and
+// httpMetricExporter are the transports provided by this package.
+type metricExporter interface {
+	Export(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) error
+}
+
+// Exporter is an OpenTelemetry metric exporter that transforms SDK checkpoint
+// sets into OTLP ExportMetricsServiceRequest messages and ships them to a
+// collector.
+type Exporter struct {
+	cfg config
+
+	lock    sync.RWMutex
+	started bool
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+
+	clientConn *grpc.ClientConn
+
+	metricExporter metricExporter
+	promClient     PrometheusRemoteWriteClient
+
+	adjuster  *adjuster
+	staleness *stalenessTracker
+	now       func() time.Time
+}
+
+var _ metricsdk.Exporter = (*Exporter)(nil)
+
+// NewExporter constructs and starts a new Exporter using the configuration
+// produced by applying opts.
+func NewExporter(ctx context.Context, opts ...ExporterOption) (*Exporter, error) {
+	exp := NewUnstartedExporter(opts...)
+	if err := exp.Start(ctx); err != nil {
+		return nil, err
+	}
+	return exp, nil
+}
+
+// NewUnstartedExporter constructs a new Exporter that has not yet dialed its
+// collector. Call Start to establish the connection. This is primarily
+// useful for tests that want to substitute their own metricExporter.
+func NewUnstartedExporter(opts ...ExporterOption) *Exporter {
+	cfg := config{
+		workerCount: DefaultWorkerCount,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &Exporter{
+		cfg:        cfg,
+		promClient: cfg.promClient,
+		adjuster:   newAdjuster(cfg.temporality),
+		staleness:  newStalenessTracker(),
+		now:        time.Now,
+	}
+}
+
+// Start connects to the configured collector and marks the Exporter ready
+// to export. It always installs a new transport, replacing any
+// metricExporter already set on the Exporter. If WithHTTPEndpoint was
+// used, the HTTP transport is selected; otherwise the Exporter dials the
+// collector over gRPC.
+func (e *Exporter) Start(ctx context.Context) error {
+	var err = errAlreadyStarted
+	e.startOnce.Do(func() {
+		e.lock.Lock()
+		defer e.lock.Unlock()
+
+		if e.cfg.httpEndpoint != "" {
+			e.metricExporter = newHTTPMetricExporter(e.cfg)
+			e.started = true
+			err = nil
+			return
+		}
+
+		var dialOpts []grpc.DialOption
+		if e.cfg.clientCredentials != nil {
+			dialOpts = append(dialOpts, grpc.WithTransportCredentials(e.cfg.clientCredentials))
+		} else if e.cfg.canDialInsecure {
+			dialOpts = append(dialOpts, grpc.WithInsecure())
+		}
+		if e.cfg.compressor != "" {
+			dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(grpc.UseCompressor(e.cfg.compressor)))
+		}
+		// User-supplied dial options are appended last so they take
+		// preference over the built-ins above, matching WithGRPCDialOption's
+		// doc comment.
+		dialOpts = append(dialOpts, e.cfg.grpcDialOptions...)
+
+		var conn *grpc.ClientConn
+		conn, err = grpc.DialContext(ctx, e.cfg.collectorAddr, dialOpts...)
+		if err != nil {
+			return
+		}
+
+		e.clientConn = conn
+		e.metricExporter = &grpcMetricExporter{client: colmetricpb.NewMetricsServiceClient(conn)}
+		e.started = true
+		err = nil
+	})
+	return err
+}
+
+// Stop closes the underlying connection to the collector, if one was
+// established by Start.
+func (e *Exporter) Stop(ctx context.Context) error {
+	var err error
+	e.stopOnce.Do(func() {
+		e.lock.Lock()
+		defer e.lock.Unlock()
+
+		e.started = false
+		if e.clientConn != nil {
+			err = e.clientConn.Close()
+		}
+	})
+	return err
+}
+
+// Export transforms the checkpoint set for resource into an
+// ExportMetricsServiceRequest and delivers it via the configured
+// metricExporter. Empty checkpoint sets are not sent, except that with
+// WithStalenessMarkers a request carrying only stale points is still sent
+// when series have disappeared. When WithPrometheusRemoteWriteClient is
+// set, the checkpoint set is sent as a Prometheus WriteRequest instead.
+func (e *Exporter) Export(ctx context.Context, res *resource.Resource, cps metricsdk.CheckpointSet) error {
+	e.lock.RLock()
+	started := e.started
+	e.lock.RUnlock()
+	if !started {
+		return errors.New("otlp: exporter is not started")
+	}
+
+	if e.promClient != nil {
+		return e.exportPrometheus(ctx, res, cps)
+	}
+
+	rm, err := transformCheckpointSet(ctx, res, cps, e.cfg.workerCount, e.cfg.withoutPreAggregation)
+	if err != nil {
+		return err
+	}
+
+	now := e.now()
+
+	// Adjust the real points before any stale ones are appended: stale
+	// points carry their own synthetic timestamps and must never be fed
+	// through the adjuster's temporality conversion, which would otherwise
+	// mistake them for a real observation of the series (see forget below).
+	if rm != nil {
+		e.adjuster.adjust(rm, res, now)
+	}
+
+	if e.cfg.stalenessMarkers {
+		if rm == nil {
+			// There may still be series to mark stale even though this
+			// checkpoint set produced no points of its own.
+			rm = &metricpb.ResourceMetrics{Resource: transformResource(res)}
+		}
+		var resourceKey label.Distinct
+		if res != nil {
+			resourceKey = res.Equivalent()
+		}
+		stale := e.staleness.markStale(rm, resourceKey, now)
+		for _, key := range stale {
+			// The series is gone for this cycle; forget its adjuster state
+			// so that when it reappears it is treated as new rather than
+			// adjusted against the value it had before the gap.
+			e.adjuster.forget(key)
+		}
+		if len(rm.InstrumentationLibraryMetrics) == 0 {
+			rm = nil
+		}
+	}
+	if rm == nil {
+		return nil
+	}
+
+	return e.metricExporter.Export(ctx, &colmetricpb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricpb.ResourceMetrics{rm},
+	})
+}
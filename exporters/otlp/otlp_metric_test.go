@@ -17,6 +17,7 @@ package otlp
 import (
 	"context"
 	"testing"
+	"time"
 
 	colmetricpb "github.com/open-telemetry/opentelemetry-proto/gen/go/collector/metrics/v1"
 	commonpb "github.com/open-telemetry/opentelemetry-proto/gen/go/common/v1"
@@ -34,22 +35,20 @@ import (
 	"go.opentelemetry.io/otel/sdk/metric/aggregator/minmaxsumcount"
 	"go.opentelemetry.io/otel/sdk/metric/aggregator/sum"
 	"go.opentelemetry.io/otel/sdk/resource"
-
-	"google.golang.org/grpc"
 )
 
 type metricsServiceClientStub struct {
 	rm []metricpb.ResourceMetrics
 }
 
-func (m *metricsServiceClientStub) Export(ctx context.Context, in *colmetricpb.ExportMetricsServiceRequest, opts ...grpc.CallOption) (*colmetricpb.ExportMetricsServiceResponse, error) {
+func (m *metricsServiceClientStub) Export(ctx context.Context, in *colmetricpb.ExportMetricsServiceRequest) error {
 	for _, rm := range in.GetResourceMetrics() {
 		if rm == nil {
 			continue
 		}
 		m.rm = append(m.rm, *rm)
 	}
-	return &colmetricpb.ExportMetricsServiceResponse{}, nil
+	return nil
 }
 
 func (m *metricsServiceClientStub) ResourceMetrics() []metricpb.ResourceMetrics {
@@ -82,6 +81,16 @@ type record struct {
 	labels   []core.KeyValue
 }
 
+// testExportTime is the fixed clock runMetricExportTestWithCollector installs
+// on every Exporter it builds, so the start/end timestamps the adjuster
+// stamps onto every data point are deterministic and assertable. Every point
+// in these tests is a series' first (and only) observation, so its start and
+// end both equal testExportTime.
+var (
+	testExportTime = time.Unix(1500000000, 0)
+	testStartEnd   = uint64(testExportTime.UnixNano())
+)
+
 var (
 	baseKeyValues = []core.KeyValue{key.String("host", "test.com")}
 	cpuKey        = core.Key("CPU")
@@ -169,7 +178,9 @@ func TestNoGroupingExport(t *testing.T) {
 								MetricDescriptor: cpu1MD,
 								Int64DataPoints: []*metricpb.Int64DataPoint{
 									{
-										Value: 11,
+										Value:             11,
+										StartTimeUnixNano: testStartEnd,
+										TimeUnixNano:      testStartEnd,
 									},
 								},
 							},
@@ -177,7 +188,9 @@ func TestNoGroupingExport(t *testing.T) {
 								MetricDescriptor: cpu2MD,
 								Int64DataPoints: []*metricpb.Int64DataPoint{
 									{
-										Value: 11,
+										Value:             11,
+										StartTimeUnixNano: testStartEnd,
+										TimeUnixNano:      testStartEnd,
 									},
 								},
 							},
@@ -219,24 +232,15 @@ func TestMeasureMetricGroupingExport(t *testing.T) {
 									},
 								},
 							},
+							// Both records share the same resource, library,
+							// descriptor, and label set, so the exporter
+							// merges them into a single data point.
 							SummaryDataPoints: []*metricpb.SummaryDataPoint{
 								{
-									Count: 2,
-									Sum:   11,
-									PercentileValues: []*metricpb.SummaryDataPoint_ValueAtPercentile{
-										{
-											Percentile: 0.0,
-											Value:      1.0,
-										},
-										{
-											Percentile: 100.0,
-											Value:      10.0,
-										},
-									},
-								},
-								{
-									Count: 2,
-									Sum:   11,
+									Count:             4,
+									Sum:               22,
+									StartTimeUnixNano: testStartEnd,
+									TimeUnixNano:      testStartEnd,
 									PercentileValues: []*metricpb.SummaryDataPoint_ValueAtPercentile{
 										{
 											Percentile: 0.0,
@@ -283,12 +287,14 @@ func TestCountInt64MetricGroupingExport(t *testing.T) {
 						Metrics: []*metricpb.Metric{
 							{
 								MetricDescriptor: cpu1MD,
+								// Both records share the same resource, library,
+								// descriptor, and label set, so the exporter merges
+								// them into a single point.
 								Int64DataPoints: []*metricpb.Int64DataPoint{
 									{
-										Value: 11,
-									},
-									{
-										Value: 11,
+										Value:             22,
+										StartTimeUnixNano: testStartEnd,
+										TimeUnixNano:      testStartEnd,
 									},
 								},
 							},
@@ -300,6 +306,31 @@ func TestCountInt64MetricGroupingExport(t *testing.T) {
 	)
 }
 
+func TestCountInt64MetricGroupingDisabledByWithoutPreAggregation(t *testing.T) {
+	desc := metric.NewDescriptor("int64-count", metric.CounterKind, core.Int64NumberKind)
+	labs := label.NewSet(append(baseKeyValues, cpuKey.Int(1))...)
+
+	newRecord := func() metricsdk.Record {
+		agg := sum.New()
+		ctx := context.Background()
+		require.NoError(t, agg.Update(ctx, core.NewInt64Number(11), &desc))
+		agg.Checkpoint(ctx, &desc)
+		return metricsdk.NewRecord(&desc, &labs, agg)
+	}
+
+	msc := &metricsServiceClientStub{}
+	exp := NewUnstartedExporter(WithoutPreAggregation())
+	exp.metricExporter = msc
+	exp.started = true
+
+	cps := checkpointSet{records: []metricsdk.Record{newRecord(), newRecord()}}
+	require.NoError(t, exp.Export(context.Background(), nil, cps))
+
+	metrics := msc.ResourceMetrics()[0].InstrumentationLibraryMetrics[0].Metrics
+	require.Len(t, metrics, 1, "both records share the same descriptor and label set")
+	assert.Len(t, metrics[0].Int64DataPoints, 2, "WithoutPreAggregation must keep each record as its own data point")
+}
+
 func TestCountUint64MetricGroupingExport(t *testing.T) {
 	r := record{
 		"uint64-count",
@@ -335,10 +366,9 @@ func TestCountUint64MetricGroupingExport(t *testing.T) {
 								},
 								Int64DataPoints: []*metricpb.Int64DataPoint{
 									{
-										Value: 11,
-									},
-									{
-										Value: 11,
+										Value:             22,
+										StartTimeUnixNano: testStartEnd,
+										TimeUnixNano:      testStartEnd,
 									},
 								},
 							},
@@ -385,10 +415,9 @@ func TestCountFloat64MetricGroupingExport(t *testing.T) {
 								},
 								DoubleDataPoints: []*metricpb.DoubleDataPoint{
 									{
-										Value: 11,
-									},
-									{
-										Value: 11,
+										Value:             22,
+										StartTimeUnixNano: testStartEnd,
+										TimeUnixNano:      testStartEnd,
 									},
 								},
 							},
@@ -445,12 +474,14 @@ func TestResourceMetricGroupingExport(t *testing.T) {
 						Metrics: []*metricpb.Metric{
 							{
 								MetricDescriptor: cpu1MD,
+								// The two testInstA/cpu1 records share a
+								// resource, library, descriptor, and label
+								// set, so they are merged into one point.
 								Int64DataPoints: []*metricpb.Int64DataPoint{
 									{
-										Value: 11,
-									},
-									{
-										Value: 11,
+										Value:             22,
+										StartTimeUnixNano: testStartEnd,
+										TimeUnixNano:      testStartEnd,
 									},
 								},
 							},
@@ -458,7 +489,9 @@ func TestResourceMetricGroupingExport(t *testing.T) {
 								MetricDescriptor: cpu2MD,
 								Int64DataPoints: []*metricpb.Int64DataPoint{
 									{
-										Value: 11,
+										Value:             11,
+										StartTimeUnixNano: testStartEnd,
+										TimeUnixNano:      testStartEnd,
 									},
 								},
 							},
@@ -475,7 +508,9 @@ func TestResourceMetricGroupingExport(t *testing.T) {
 								MetricDescriptor: cpu1MD,
 								Int64DataPoints: []*metricpb.Int64DataPoint{
 									{
-										Value: 11,
+										Value:             11,
+										StartTimeUnixNano: testStartEnd,
+										TimeUnixNano:      testStartEnd,
 									},
 								},
 							},
@@ -553,12 +588,14 @@ func TestResourceInstLibMetricGroupingExport(t *testing.T) {
 						Metrics: []*metricpb.Metric{
 							{
 								MetricDescriptor: cpu1MD,
+								// The two couting-lib/testInstA/cpu1 records share a
+								// resource, library, descriptor, and label set, so
+								// they are merged into one point.
 								Int64DataPoints: []*metricpb.Int64DataPoint{
 									{
-										Value: 11,
-									},
-									{
-										Value: 11,
+										Value:             22,
+										StartTimeUnixNano: testStartEnd,
+										TimeUnixNano:      testStartEnd,
 									},
 								},
 							},
@@ -566,7 +603,9 @@ func TestResourceInstLibMetricGroupingExport(t *testing.T) {
 								MetricDescriptor: cpu2MD,
 								Int64DataPoints: []*metricpb.Int64DataPoint{
 									{
-										Value: 11,
+										Value:             11,
+										StartTimeUnixNano: testStartEnd,
+										TimeUnixNano:      testStartEnd,
 									},
 								},
 							},
@@ -581,7 +620,9 @@ func TestResourceInstLibMetricGroupingExport(t *testing.T) {
 								MetricDescriptor: cpu1MD,
 								Int64DataPoints: []*metricpb.Int64DataPoint{
 									{
-										Value: 11,
+										Value:             11,
+										StartTimeUnixNano: testStartEnd,
+										TimeUnixNano:      testStartEnd,
 									},
 								},
 							},
@@ -601,7 +642,9 @@ func TestResourceInstLibMetricGroupingExport(t *testing.T) {
 								MetricDescriptor: cpu1MD,
 								Int64DataPoints: []*metricpb.Int64DataPoint{
 									{
-										Value: 11,
+										Value:             11,
+										StartTimeUnixNano: testStartEnd,
+										TimeUnixNano:      testStartEnd,
 									},
 								},
 							},
@@ -613,7 +656,15 @@ func TestResourceInstLibMetricGroupingExport(t *testing.T) {
 	)
 }
 
-// What works single-threaded should work multi-threaded
+// metricsCollector is satisfied by whatever receives the Exporter's
+// ExportMetricsServiceRequests in a test, whether that's an in-process stub
+// (gRPC backend) or an httptest.Server (HTTP backend).
+type metricsCollector interface {
+	ResourceMetrics() []metricpb.ResourceMetrics
+}
+
+// What works single-threaded should work multi-threaded, and the same
+// records/expectations should export identically regardless of transport.
 func runMetricExportTests(t *testing.T, rs []record, expected []metricpb.ResourceMetrics) {
 	t.Run("1 goroutine", func(t *testing.T) {
 		runMetricExportTest(t, NewUnstartedExporter(WorkerCount(1)), rs, expected)
@@ -621,6 +672,12 @@ func runMetricExportTests(t *testing.T, rs []record, expected []metricpb.Resourc
 	t.Run("20 goroutines", func(t *testing.T) {
 		runMetricExportTest(t, NewUnstartedExporter(WorkerCount(20)), rs, expected)
 	})
+	t.Run("http protobuf", func(t *testing.T) {
+		runMetricExportHTTPTest(t, false, rs, expected)
+	})
+	t.Run("http json", func(t *testing.T) {
+		runMetricExportHTTPTest(t, true, rs, expected)
+	})
 }
 
 func runMetricExportTest(t *testing.T, exp *Exporter, rs []record, expected []metricpb.ResourceMetrics) {
@@ -628,6 +685,12 @@ func runMetricExportTest(t *testing.T, exp *Exporter, rs []record, expected []me
 	exp.metricExporter = msc
 	exp.started = true
 
+	runMetricExportTestWithCollector(t, exp, msc, rs, expected)
+}
+
+func runMetricExportTestWithCollector(t *testing.T, exp *Exporter, collector metricsCollector, rs []record, expected []metricpb.ResourceMetrics) {
+	exp.now = func() time.Time { return testExportTime }
+
 	recs := map[label.Distinct][]metricsdk.Record{}
 	resources := map[label.Distinct]*resource.Resource{}
 	for _, r := range rs {
@@ -676,7 +739,7 @@ func runMetricExportTest(t *testing.T, exp *Exporter, rs []record, expected []me
 		resource, instrumentationLibrary string
 	}
 	got := map[key][]*metricpb.Metric{}
-	for _, rm := range msc.ResourceMetrics() {
+	for _, rm := range collector.ResourceMetrics() {
 		for _, ilm := range rm.InstrumentationLibraryMetrics {
 			k := key{
 				resource:               rm.GetResource().String(),
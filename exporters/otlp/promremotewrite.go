@@ -0,0 +1,371 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+
+	"go.opentelemetry.io/otel/api/core"
+	"go.opentelemetry.io/otel/api/label"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/api/unit"
+	metricsdk "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/export/metric/aggregator"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// PrometheusRemoteWriteClient delivers a Prometheus remote-write
+// WriteRequest to a backend such as Mimir, Cortex, or Thanos. Implementations
+// are responsible for framing (snappy compression) and transport; use
+// NewPrometheusRemoteWriteClient for the built-in HTTP implementation.
+type PrometheusRemoteWriteClient interface {
+	Write(ctx context.Context, req *prompb.WriteRequest) error
+}
+
+// histogramAggregator is satisfied by aggregators that expose a bucketed
+// distribution, such as the SDK's histogram aggregator.
+type histogramAggregator interface {
+	sumAggregator
+	Count() (int64, error)
+	Histogram() (aggregator.Buckets, error)
+}
+
+// minMaxSumCountAggregatorPrometheus is another name for
+// minMaxSumCountAggregator, declared in transform.go; it is the same
+// interface.
+type minMaxSumCountAggregatorPrometheus = minMaxSumCountAggregator
+
+// exportPrometheus translates cps into a single Prometheus WriteRequest and
+// delivers it via e.promClient. Checkpoint sets with no records produce no
+// request.
+func (e *Exporter) exportPrometheus(ctx context.Context, res *resource.Resource, cps metricsdk.CheckpointSet) error {
+	req, err := transformPrometheusWriteRequest(res, cps, e.cfg.externalLabels, e.cfg.withoutPreAggregation, e.now())
+	if err != nil {
+		return err
+	}
+	if req == nil {
+		return nil
+	}
+	return e.promClient.Write(ctx, req)
+}
+
+// transformPrometheusWriteRequest converts cps into a WriteRequest. Unless
+// withoutPreAggregation is set, records sharing a resource, instrumentation
+// library, descriptor, and label set are merged via groupRecords before
+// being translated, so each group yields one set of series; remote-write
+// receivers such as Cortex/Mimir reject a request carrying the same series
+// more than once. Records from different instrumentation libraries are not
+// merged, even when they share a metric name and label set. Every sample
+// is stamped with now, converted to milliseconds
+// since the epoch as the remote-write wire format requires.
+func transformPrometheusWriteRequest(res *resource.Resource, cps metricsdk.CheckpointSet, externalLabels map[string]string, withoutPreAggregation bool, now time.Time) (*prompb.WriteRequest, error) {
+	nowMS := now.UnixNano() / int64(time.Millisecond)
+
+	var series []*prompb.TimeSeries
+	addSeries := func(r record) error {
+		ts, err := prometheusTimeSeries(r, res, externalLabels, nowMS)
+		if err != nil {
+			return err
+		}
+		series = append(series, ts...)
+		return nil
+	}
+
+	if withoutPreAggregation {
+		if err := cps.ForEach(func(r metricsdk.Record) error { return addSeries(r) }); err != nil {
+			return nil, err
+		}
+	} else {
+		groups, order, err := groupRecords(cps)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range order {
+			if err := addSeries(groups[key]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(series) == 0 {
+		return nil, nil
+	}
+	return &prompb.WriteRequest{Timeseries: series}, nil
+}
+
+// prometheusTimeSeries converts a single record into one or more Prometheus
+// time series: counters and gauges produce one series, minmaxsumcount
+// aggregators expand into _sum/_count/_min/_max, and histograms expand into
+// _bucket{le=...}/_sum/_count. nowMS is stamped onto every sample as its
+// Timestamp, in milliseconds since the epoch.
+func prometheusTimeSeries(r record, res *resource.Resource, externalLabels map[string]string, nowMS int64) ([]*prompb.TimeSeries, error) {
+	desc := r.Descriptor()
+	baseLabels := prometheusLabels(desc, r.Labels(), res, externalLabels)
+
+	switch agg := r.Aggregator().(type) {
+	case histogramAggregator:
+		return histogramTimeSeries(desc, agg, baseLabels, nowMS)
+	case minMaxSumCountAggregatorPrometheus:
+		return minMaxSumCountTimeSeries(desc, agg, baseLabels, nowMS)
+	case sumAggregator:
+		value, err := agg.Sum()
+		if err != nil {
+			return nil, err
+		}
+		name, scale := prometheusMetricName(desc)
+		return []*prompb.TimeSeries{
+			namedSeries(baseLabels, name, value.CoerceToFloat64(desc.NumberKind())*scale, nowMS),
+		}, nil
+	default:
+		return nil, fmt.Errorf("otlp: prometheus exporter cannot translate aggregator for %q", desc.Name())
+	}
+}
+
+func minMaxSumCountTimeSeries(desc *metric.Descriptor, agg minMaxSumCountAggregatorPrometheus, baseLabels []prompb.Label, nowMS int64) ([]*prompb.TimeSeries, error) {
+	count, err := agg.Count()
+	if err != nil {
+		return nil, err
+	}
+	sum, err := agg.Sum()
+	if err != nil {
+		return nil, err
+	}
+	min, err := agg.Min()
+	if err != nil {
+		return nil, err
+	}
+	max, err := agg.Max()
+	if err != nil {
+		return nil, err
+	}
+
+	base, scale := prometheusMetricName(desc)
+	kind := desc.NumberKind()
+	return []*prompb.TimeSeries{
+		namedSeries(baseLabels, base+"_sum", sum.CoerceToFloat64(kind)*scale, nowMS),
+		namedSeries(baseLabels, base+"_count", float64(count), nowMS),
+		namedSeries(baseLabels, base+"_min", min.CoerceToFloat64(kind)*scale, nowMS),
+		namedSeries(baseLabels, base+"_max", max.CoerceToFloat64(kind)*scale, nowMS),
+	}, nil
+}
+
+func histogramTimeSeries(desc *metric.Descriptor, agg histogramAggregator, baseLabels []prompb.Label, nowMS int64) ([]*prompb.TimeSeries, error) {
+	sum, err := agg.Sum()
+	if err != nil {
+		return nil, err
+	}
+	count, err := agg.Count()
+	if err != nil {
+		return nil, err
+	}
+	buckets, err := agg.Histogram()
+	if err != nil {
+		return nil, err
+	}
+
+	base, scale := prometheusMetricName(desc)
+	out := make([]*prompb.TimeSeries, 0, len(buckets.Boundaries)+3)
+	var cumulative uint64
+	for i, boundary := range buckets.Boundaries {
+		cumulative += buckets.Counts[i]
+		le := fmt.Sprintf("%g", boundary*scale)
+		out = append(out, namedSeries(append(cloneLabels(baseLabels), prompb.Label{Name: "le", Value: le}), base+"_bucket", float64(cumulative), nowMS))
+	}
+	cumulative += buckets.Counts[len(buckets.Counts)-1]
+	out = append(out, namedSeries(append(cloneLabels(baseLabels), prompb.Label{Name: "le", Value: "+Inf"}), base+"_bucket", float64(cumulative), nowMS))
+	out = append(out, namedSeries(baseLabels, base+"_sum", sum.CoerceToFloat64(desc.NumberKind())*scale, nowMS))
+	out = append(out, namedSeries(baseLabels, base+"_count", float64(count), nowMS))
+	return out, nil
+}
+
+func namedSeries(labels []prompb.Label, name string, value float64, timestampMS int64) *prompb.TimeSeries {
+	return &prompb.TimeSeries{
+		Labels:  append(cloneLabels(labels), prompb.Label{Name: "__name__", Value: name}),
+		Samples: []prompb.Sample{{Value: value, Timestamp: timestampMS}},
+	}
+}
+
+func cloneLabels(labels []prompb.Label) []prompb.Label {
+	out := make([]prompb.Label, len(labels))
+	copy(out, labels)
+	return out
+}
+
+// prometheusLabels builds the label set shared by every series derived from
+// a record: the instrument's labels, the resource's attributes (as external
+// labels), and any statically configured external labels.
+func prometheusLabels(desc *metric.Descriptor, labels *label.Set, res *resource.Resource, externalLabels map[string]string) []prompb.Label {
+	var out []prompb.Label
+	if labels != nil {
+		iter := labels.Iter()
+		for iter.Next() {
+			kv := iter.Label()
+			out = append(out, prompb.Label{Name: sanitizeLabelName(string(kv.Key)), Value: kv.Value.Emit()})
+		}
+	}
+	if res != nil {
+		for _, kv := range res.Attributes() {
+			out = append(out, prompb.Label{Name: sanitizeLabelName(string(kv.Key)), Value: kv.Value.Emit()})
+		}
+	}
+	for k, v := range externalLabels {
+		out = append(out, prompb.Label{Name: sanitizeLabelName(k), Value: v})
+	}
+	return out
+}
+
+// prometheusMetricName derives the Prometheus metric name for desc,
+// sanitizing illegal runes and appending the standard unit/monotonicity
+// suffixes OTel-to-Prometheus translators use. It also returns the scale
+// factor that must be multiplied into every sample value reported under
+// that name, since renaming a unit (e.g. ms to the "_seconds" suffix)
+// without converting the value would mislabel it.
+func prometheusMetricName(desc *metric.Descriptor) (name string, scale float64) {
+	name = sanitizeMetricName(desc.Name())
+	if desc.MetricKind() == metric.CounterKind {
+		name += "_total"
+	}
+	suffix, scale := unitSuffixAndScale(desc.Unit())
+	name += suffix
+	return name, scale
+}
+
+// unitSuffixAndScale returns the Prometheus unit suffix for u and the factor
+// by which a value denominated in u must be multiplied to match it.
+func unitSuffixAndScale(u unit.Unit) (suffix string, scale float64) {
+	switch u {
+	case unit.Bytes:
+		return "_bytes", 1
+	case unit.Milliseconds:
+		return "_seconds", 0.001
+	default:
+		return "", 1
+	}
+}
+
+var (
+	invalidMetricNameChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+	invalidLabelNameChars  = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// sanitizeMetricName replaces runes that are illegal in a Prometheus metric
+// name with underscores and prefixes a leading digit, matching the
+// conventions other OTel-to-Prometheus translators use.
+func sanitizeMetricName(name string) string {
+	name = invalidMetricNameChars.ReplaceAllString(name, "_")
+	if name == "" {
+		return "_"
+	}
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// sanitizeLabelName replaces illegal runes in a Prometheus label name,
+// prefixes a leading digit, and renames reserved "__"-prefixed labels so
+// they are not dropped by the remote-write receiver.
+func sanitizeLabelName(name string) string {
+	name = invalidLabelNameChars.ReplaceAllString(name, "_")
+	if name == "" {
+		return "_"
+	}
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	if len(name) >= 2 && name[0] == '_' && name[1] == '_' {
+		name = "key" + name
+	}
+	return name
+}
+
+// httpPrometheusRemoteWriteClient is the built-in PrometheusRemoteWriteClient
+// that snappy-frames the WriteRequest and POSTs it to a remote-write
+// endpoint.
+type httpPrometheusRemoteWriteClient struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+// HTTPRemoteWriteClientOption configures an HTTP PrometheusRemoteWriteClient.
+type HTTPRemoteWriteClientOption func(*httpPrometheusRemoteWriteClient)
+
+// WithRemoteWriteHTTPClient overrides the *http.Client used to deliver
+// requests. The default is http.DefaultClient.
+func WithRemoteWriteHTTPClient(c *http.Client) HTTPRemoteWriteClientOption {
+	return func(w *httpPrometheusRemoteWriteClient) {
+		w.client = c
+	}
+}
+
+// WithRemoteWriteHeaders sets additional headers, such as authentication
+// credentials, to send with every request.
+func WithRemoteWriteHeaders(headers map[string]string) HTTPRemoteWriteClientOption {
+	return func(w *httpPrometheusRemoteWriteClient) {
+		w.headers = headers
+	}
+}
+
+// NewPrometheusRemoteWriteClient returns a PrometheusRemoteWriteClient that
+// POSTs snappy-compressed WriteRequest protobufs to endpoint.
+func NewPrometheusRemoteWriteClient(endpoint string, opts ...HTTPRemoteWriteClientOption) PrometheusRemoteWriteClient {
+	c := &httpPrometheusRemoteWriteClient{
+		endpoint: endpoint,
+		client:   http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *httpPrometheusRemoteWriteClient) Write(ctx context.Context, req *prompb.WriteRequest) error {
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("otlp: marshaling prometheus write request: %w", err)
+	}
+	compressed := snappy.Encode(nil, data)
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(compressed))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Encoding", "snappy")
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for k, v := range c.headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp: prometheus remote write returned status %d", resp.StatusCode)
+	}
+	return nil
+}
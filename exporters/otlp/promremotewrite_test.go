@@ -0,0 +1,275 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/otel/api/core"
+	"go.opentelemetry.io/otel/api/key"
+	"go.opentelemetry.io/otel/api/label"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/api/unit"
+	metricsdk "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/metric/aggregator/histogram"
+	"go.opentelemetry.io/otel/sdk/metric/aggregator/minmaxsumcount"
+	"go.opentelemetry.io/otel/sdk/metric/aggregator/sum"
+)
+
+// exportPrometheusSeries runs a single Export of a checkpoint set holding agg
+// under desc/labs through a Prometheus-backed Exporter and returns the
+// resulting time series.
+func exportPrometheusSeries(t *testing.T, desc *metric.Descriptor, labs *label.Set, agg metricsdk.Aggregator) []*prompb.TimeSeries {
+	t.Helper()
+
+	client := &promRemoteWriteClientStub{}
+	exp := NewUnstartedExporter(WithPrometheusRemoteWriteClient(client))
+	exp.started = true
+
+	cps := checkpointSet{records: []metricsdk.Record{metricsdk.NewRecord(desc, labs, agg)}}
+	require.NoError(t, exp.Export(context.Background(), nil, cps))
+
+	require.Len(t, client.reqs, 1)
+	return client.reqs[0].Timeseries
+}
+
+// seriesByName indexes ts by its __name__ label.
+func seriesByName(ts []*prompb.TimeSeries) map[string]*prompb.TimeSeries {
+	out := map[string]*prompb.TimeSeries{}
+	for _, s := range ts {
+		for _, l := range s.Labels {
+			if l.Name == "__name__" {
+				out[l.Value] = s
+			}
+		}
+	}
+	return out
+}
+
+type promRemoteWriteClientStub struct {
+	reqs []*prompb.WriteRequest
+}
+
+func (c *promRemoteWriteClientStub) Write(ctx context.Context, req *prompb.WriteRequest) error {
+	c.reqs = append(c.reqs, req)
+	return nil
+}
+
+func TestPrometheusRemoteWriteCounterExport(t *testing.T) {
+	client := &promRemoteWriteClientStub{}
+	exp := NewUnstartedExporter(WithPrometheusRemoteWriteClient(client))
+	exp.started = true
+
+	desc := metric.NewDescriptor("requests", metric.CounterKind, core.Int64NumberKind)
+	labs := label.NewSet(key.String("host", "test.com"))
+
+	agg := sum.New()
+	ctx := context.Background()
+	require.NoError(t, agg.Update(ctx, core.NewInt64Number(5), &desc))
+	agg.Checkpoint(ctx, &desc)
+
+	cps := checkpointSet{records: []metricsdk.Record{metricsdk.NewRecord(&desc, &labs, agg)}}
+	require.NoError(t, exp.Export(ctx, nil, cps))
+
+	require.Len(t, client.reqs, 1)
+	require.Len(t, client.reqs[0].Timeseries, 1)
+	ts := client.reqs[0].Timeseries[0]
+
+	var gotName, gotHost string
+	for _, l := range ts.Labels {
+		switch l.Name {
+		case "__name__":
+			gotName = l.Value
+		case "host":
+			gotHost = l.Value
+		}
+	}
+	assert.Equal(t, "requests_total", gotName)
+	assert.Equal(t, "test.com", gotHost)
+	require.Len(t, ts.Samples, 1)
+	assert.Equal(t, float64(5), ts.Samples[0].Value)
+}
+
+func TestPrometheusRemoteWriteStampsSampleTimestamp(t *testing.T) {
+	client := &promRemoteWriteClientStub{}
+	exp := NewUnstartedExporter(WithPrometheusRemoteWriteClient(client))
+	exp.started = true
+
+	clock := time.Unix(1500000000, 0)
+	exp.now = func() time.Time { return clock }
+
+	desc := metric.NewDescriptor("requests", metric.CounterKind, core.Int64NumberKind)
+	labs := label.NewSet(key.String("host", "test.com"))
+
+	agg := sum.New()
+	ctx := context.Background()
+	require.NoError(t, agg.Update(ctx, core.NewInt64Number(5), &desc))
+	agg.Checkpoint(ctx, &desc)
+
+	cps := checkpointSet{records: []metricsdk.Record{metricsdk.NewRecord(&desc, &labs, agg)}}
+	require.NoError(t, exp.Export(ctx, nil, cps))
+
+	require.Len(t, client.reqs, 1)
+	require.Len(t, client.reqs[0].Timeseries, 1)
+	assert.Equal(t, clock.UnixNano()/int64(time.Millisecond), client.reqs[0].Timeseries[0].Samples[0].Timestamp,
+		"remote-write receivers reject samples timestamped at the Unix epoch as stale")
+}
+
+func TestPrometheusRemoteWriteMergesDuplicateLabelSets(t *testing.T) {
+	desc := metric.NewDescriptor("requests", metric.CounterKind, core.Int64NumberKind)
+	labs := label.NewSet(key.String("host", "test.com"))
+
+	newRecord := func(value int64) metricsdk.Record {
+		agg := sum.New()
+		ctx := context.Background()
+		require.NoError(t, agg.Update(ctx, core.NewInt64Number(value), &desc))
+		agg.Checkpoint(ctx, &desc)
+		return metricsdk.NewRecord(&desc, &labs, agg)
+	}
+
+	client := &promRemoteWriteClientStub{}
+	exp := NewUnstartedExporter(WithPrometheusRemoteWriteClient(client))
+	exp.started = true
+
+	cps := checkpointSet{records: []metricsdk.Record{newRecord(5), newRecord(6)}}
+	require.NoError(t, exp.Export(context.Background(), nil, cps))
+
+	require.Len(t, client.reqs, 1)
+	ts := client.reqs[0].Timeseries
+	require.Len(t, ts, 1, "two records sharing a label set must be merged into a single series")
+	assert.Equal(t, float64(11), ts[0].Samples[0].Value)
+}
+
+func TestPrometheusRemoteWriteWithoutPreAggregationKeepsDuplicates(t *testing.T) {
+	desc := metric.NewDescriptor("requests", metric.CounterKind, core.Int64NumberKind)
+	labs := label.NewSet(key.String("host", "test.com"))
+
+	newRecord := func(value int64) metricsdk.Record {
+		agg := sum.New()
+		ctx := context.Background()
+		require.NoError(t, agg.Update(ctx, core.NewInt64Number(value), &desc))
+		agg.Checkpoint(ctx, &desc)
+		return metricsdk.NewRecord(&desc, &labs, agg)
+	}
+
+	client := &promRemoteWriteClientStub{}
+	exp := NewUnstartedExporter(WithPrometheusRemoteWriteClient(client), WithoutPreAggregation())
+	exp.started = true
+
+	cps := checkpointSet{records: []metricsdk.Record{newRecord(5), newRecord(6)}}
+	require.NoError(t, exp.Export(context.Background(), nil, cps))
+
+	require.Len(t, client.reqs, 1)
+	assert.Len(t, client.reqs[0].Timeseries, 2, "WithoutPreAggregation must keep each record as its own series")
+}
+
+func TestPrometheusRemoteWriteMinMaxSumCountExport(t *testing.T) {
+	desc := metric.NewDescriptor("latency", metric.MeasureKind, core.Float64NumberKind)
+	labs := label.NewSet(key.String("host", "test.com"))
+
+	agg := minmaxsumcount.New(&desc)
+	ctx := context.Background()
+	require.NoError(t, agg.Update(ctx, core.NewFloat64Number(1), &desc))
+	require.NoError(t, agg.Update(ctx, core.NewFloat64Number(9), &desc))
+	agg.Checkpoint(ctx, &desc)
+
+	ts := exportPrometheusSeries(t, &desc, &labs, agg)
+	require.Len(t, ts, 4, "expected _sum, _count, _min, and _max series")
+
+	byName := seriesByName(ts)
+	require.Contains(t, byName, "latency_sum")
+	require.Contains(t, byName, "latency_count")
+	require.Contains(t, byName, "latency_min")
+	require.Contains(t, byName, "latency_max")
+	assert.Equal(t, float64(10), byName["latency_sum"].Samples[0].Value)
+	assert.Equal(t, float64(2), byName["latency_count"].Samples[0].Value)
+	assert.Equal(t, float64(1), byName["latency_min"].Samples[0].Value)
+	assert.Equal(t, float64(9), byName["latency_max"].Samples[0].Value)
+}
+
+func TestPrometheusRemoteWriteHistogramExport(t *testing.T) {
+	boundaries := []float64{1, 5, 10}
+	desc := metric.NewDescriptor("latency", metric.MeasureKind, core.Float64NumberKind)
+	labs := label.NewSet(key.String("host", "test.com"))
+
+	agg := histogram.New(&desc, boundaries)
+	ctx := context.Background()
+	require.NoError(t, agg.Update(ctx, core.NewFloat64Number(0.5), &desc))
+	require.NoError(t, agg.Update(ctx, core.NewFloat64Number(3), &desc))
+	require.NoError(t, agg.Update(ctx, core.NewFloat64Number(20), &desc))
+	agg.Checkpoint(ctx, &desc)
+
+	ts := exportPrometheusSeries(t, &desc, &labs, agg)
+	require.Len(t, ts, len(boundaries)+1+2, "expected one _bucket series per boundary plus +Inf, _sum, and _count")
+
+	var buckets []*prompb.TimeSeries
+	byName := seriesByName(ts)
+	require.Contains(t, byName, "latency_sum")
+	require.Contains(t, byName, "latency_count")
+	assert.Equal(t, float64(23.5), byName["latency_sum"].Samples[0].Value)
+	assert.Equal(t, float64(3), byName["latency_count"].Samples[0].Value)
+
+	cumulative := map[string]float64{}
+	for _, s := range ts {
+		var name, le string
+		for _, l := range s.Labels {
+			switch l.Name {
+			case "__name__":
+				name = l.Value
+			case "le":
+				le = l.Value
+			}
+		}
+		if name == "latency_bucket" {
+			buckets = append(buckets, s)
+			cumulative[le] = s.Samples[0].Value
+		}
+	}
+	require.Len(t, buckets, len(boundaries)+1)
+	assert.Equal(t, float64(1), cumulative["1"], "the 0.5 observation falls in the le=1 bucket")
+	assert.Equal(t, float64(2), cumulative["5"], "le=5 is cumulative and also carries the le=1 observation")
+	assert.Equal(t, float64(2), cumulative["10"])
+	assert.Equal(t, float64(3), cumulative["+Inf"], "+Inf carries every observation, including the 20 that exceeds every boundary")
+}
+
+func TestPrometheusRemoteWriteUnitSuffixScalesValue(t *testing.T) {
+	desc := metric.NewDescriptor("request_latency", metric.CounterKind, core.Float64NumberKind, metric.WithUnit(unit.Milliseconds))
+	labs := label.NewSet(key.String("host", "test.com"))
+
+	agg := sum.New()
+	ctx := context.Background()
+	require.NoError(t, agg.Update(ctx, core.NewFloat64Number(500), &desc))
+	agg.Checkpoint(ctx, &desc)
+
+	ts := exportPrometheusSeries(t, &desc, &labs, agg)
+	require.Len(t, ts, 1)
+
+	byName := seriesByName(ts)
+	require.Contains(t, byName, "request_latency_total_seconds", "the millisecond unit must be renamed to seconds")
+	assert.Equal(t, float64(0.5), byName["request_latency_total_seconds"].Samples[0].Value,
+		"500ms must be reported as 0.5 to match the renamed _seconds unit")
+}
+
+func TestSanitizeMetricAndLabelNames(t *testing.T) {
+	assert.Equal(t, "_9lives", sanitizeMetricName("9lives"))
+	assert.Equal(t, "cpu_usage", sanitizeMetricName("cpu.usage"))
+	assert.Equal(t, "key__reserved", sanitizeLabelName("__reserved"))
+}
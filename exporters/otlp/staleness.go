@@ -0,0 +1,149 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"math"
+	"time"
+
+	commonpb "github.com/open-telemetry/opentelemetry-proto/gen/go/common/v1"
+	metricpb "github.com/open-telemetry/opentelemetry-proto/gen/go/metrics/v1"
+
+	"go.opentelemetry.io/otel/api/label"
+)
+
+// WithStalenessMarkers enables emitting a synthetic stale data point for
+// every series that was present in the Exporter's previous Export call but
+// is missing from the current one, so downstream systems can expire the
+// series instead of carrying its last value forward indefinitely. It is
+// disabled by default.
+//
+// This only affects the OTLP export path. It has no effect when the
+// Exporter is configured with WithPrometheusRemoteWriteClient: Prometheus
+// remote-write has no wire representation for a stale marker distinct from
+// a regular sample, and disappeared series are left for the receiver's own
+// staleness handling instead.
+func WithStalenessMarkers(enabled bool) ExporterOption {
+	return func(cfg *config) {
+		cfg.stalenessMarkers = enabled
+	}
+}
+
+// staleSeries is what the tracker remembers about a series: just enough to
+// synthesize a stale point for it if it disappears.
+type staleSeries struct {
+	library    string
+	descriptor *metricpb.MetricDescriptor
+}
+
+// stalenessTracker remembers the series seen in the previous Export call,
+// per resource, so markStale can detect which ones disappeared.
+type stalenessTracker struct {
+	lastSeen map[seriesKey]staleSeries
+}
+
+func newStalenessTracker() *stalenessTracker {
+	return &stalenessTracker{lastSeen: map[seriesKey]staleSeries{}}
+}
+
+// markStale appends a synthetic stale point to rm for every series that was
+// present in this resource's previous snapshot but is absent from rm's
+// current series, then replaces the snapshot with rm's current series. It
+// returns the keys of the series it marked stale, so callers can reset any
+// other per-series state (e.g. the adjuster's) that must not carry across
+// the gap.
+func (s *stalenessTracker) markStale(rm *metricpb.ResourceMetrics, resourceKey label.Distinct, now time.Time) []seriesKey {
+	current := map[seriesKey]staleSeries{}
+	for _, ilm := range rm.GetInstrumentationLibraryMetrics() {
+		library := ilm.GetInstrumentationLibrary().GetName()
+		for _, m := range ilm.GetMetrics() {
+			desc := m.GetMetricDescriptor()
+			key := seriesKey{resource: resourceKey, library: library, name: desc.GetName(), labels: desc.String()}
+			current[key] = staleSeries{library: library, descriptor: desc}
+		}
+	}
+
+	nowNano := uint64(now.UnixNano())
+	var stale []seriesKey
+	for key, prev := range s.lastSeen {
+		if key.resource != resourceKey {
+			continue
+		}
+		if _, ok := current[key]; ok {
+			continue
+		}
+		appendStalePoint(rm, prev, nowNano)
+		stale = append(stale, key)
+	}
+
+	for key := range s.lastSeen {
+		if key.resource == resourceKey {
+			delete(s.lastSeen, key)
+		}
+	}
+	for key, v := range current {
+		s.lastSeen[key] = v
+	}
+
+	return stale
+}
+
+// appendStalePoint adds a Metric carrying a single stale sample for prev to
+// rm, creating its InstrumentationLibraryMetrics group if needed. Doubles
+// use NaN, the conventional staleness sentinel; other numeric types have no
+// such sentinel in this wire format, so a zero sample is used instead.
+func appendStalePoint(rm *metricpb.ResourceMetrics, prev staleSeries, nowNano uint64) {
+	ilm := findOrCreateILM(rm, prev.library)
+	m := &metricpb.Metric{MetricDescriptor: prev.descriptor}
+
+	switch prev.descriptor.GetType() {
+	case metricpb.MetricDescriptor_COUNTER_DOUBLE:
+		m.DoubleDataPoints = []*metricpb.DoubleDataPoint{{
+			Value:             math.NaN(),
+			StartTimeUnixNano: nowNano,
+			TimeUnixNano:      nowNano,
+		}}
+	case metricpb.MetricDescriptor_COUNTER_INT64:
+		m.Int64DataPoints = []*metricpb.Int64DataPoint{{
+			Value:             0,
+			StartTimeUnixNano: nowNano,
+			TimeUnixNano:      nowNano,
+		}}
+	default:
+		m.SummaryDataPoints = []*metricpb.SummaryDataPoint{{
+			Count:             0,
+			Sum:               math.NaN(),
+			StartTimeUnixNano: nowNano,
+			TimeUnixNano:      nowNano,
+		}}
+	}
+
+	ilm.Metrics = append(ilm.Metrics, m)
+}
+
+func findOrCreateILM(rm *metricpb.ResourceMetrics, library string) *metricpb.InstrumentationLibraryMetrics {
+	for _, ilm := range rm.InstrumentationLibraryMetrics {
+		if ilm.GetInstrumentationLibrary().GetName() == library {
+			return ilm
+		}
+	}
+	var libpb *commonpb.InstrumentationLibrary
+	if library != "" {
+		libpb = &commonpb.InstrumentationLibrary{Name: library}
+	}
+	ilm := &metricpb.InstrumentationLibraryMetrics{InstrumentationLibrary: libpb}
+	rm.InstrumentationLibraryMetrics = append(rm.InstrumentationLibraryMetrics, ilm)
+	return ilm
+}
@@ -0,0 +1,162 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/otel/api/core"
+	"go.opentelemetry.io/otel/api/key"
+	"go.opentelemetry.io/otel/api/label"
+	"go.opentelemetry.io/otel/api/metric"
+	metricsdk "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/metric/aggregator/sum"
+)
+
+// doubleCounterCheckpoint builds a single-record checkpoint set for a
+// CounterKind float64 instrument holding value.
+func doubleCounterCheckpoint(t *testing.T, name string, value float64, labels ...core.KeyValue) checkpointSet {
+	desc := metric.NewDescriptor(name, metric.CounterKind, core.Float64NumberKind)
+	labs := label.NewSet(labels...)
+	agg := sum.New()
+	ctx := context.Background()
+	require.NoError(t, agg.Update(ctx, core.NewFloat64Number(value), &desc))
+	agg.Checkpoint(ctx, &desc)
+	return checkpointSet{records: []metricsdk.Record{metricsdk.NewRecord(&desc, &labs, agg)}}
+}
+
+func TestStalenessMarkersEmittedWhenSeriesDisappears(t *testing.T) {
+	msc := &metricsServiceClientStub{}
+	exp := NewUnstartedExporter(WithStalenessMarkers(true))
+	exp.metricExporter = msc
+	exp.started = true
+
+	clock := time.Unix(4000, 0)
+	exp.now = func() time.Time { return clock }
+
+	ctx := context.Background()
+	hostA := key.String("host", "a.test.com")
+	hostB := key.String("host", "b.test.com")
+
+	require.NoError(t, exp.Export(ctx, nil, counterCheckpoint(t, "requests", 1, hostA)))
+	require.Len(t, msc.ResourceMetrics()[0].InstrumentationLibraryMetrics[0].Metrics, 1)
+
+	msc.Reset()
+	clock = clock.Add(time.Second)
+	// The second export drops host=a.test.com and introduces host=b.test.com.
+	require.NoError(t, exp.Export(ctx, nil, counterCheckpoint(t, "requests", 1, hostB)))
+
+	metrics := msc.ResourceMetrics()[0].InstrumentationLibraryMetrics[0].Metrics
+	require.Len(t, metrics, 2, "expected the live b.test.com series plus a stale marker for a.test.com")
+
+	var found bool
+	for _, m := range metrics {
+		for _, l := range m.MetricDescriptor.Labels {
+			if l.Key == "host" && l.Value == "a.test.com" {
+				found = true
+				require.Len(t, m.Int64DataPoints, 1)
+				assert.Equal(t, int64(0), m.Int64DataPoints[0].Value)
+			}
+		}
+	}
+	assert.True(t, found, "expected a stale point for the disappeared a.test.com series")
+}
+
+func TestStalenessMarkersDisabledByDefault(t *testing.T) {
+	msc := &metricsServiceClientStub{}
+	exp := NewUnstartedExporter()
+	exp.metricExporter = msc
+	exp.started = true
+
+	clock := time.Unix(5000, 0)
+	exp.now = func() time.Time { return clock }
+
+	ctx := context.Background()
+	hostA := key.String("host", "a.test.com")
+	hostB := key.String("host", "b.test.com")
+
+	require.NoError(t, exp.Export(ctx, nil, counterCheckpoint(t, "requests", 1, hostA)))
+	msc.Reset()
+	require.NoError(t, exp.Export(ctx, nil, counterCheckpoint(t, "requests", 1, hostB)))
+
+	metrics := msc.ResourceMetrics()[0].InstrumentationLibraryMetrics[0].Metrics
+	assert.Len(t, metrics, 1, "without WithStalenessMarkers, disappeared series are not backfilled")
+}
+
+func TestStalenessMarkerDoublePointIsNaN(t *testing.T) {
+	msc := &metricsServiceClientStub{}
+	exp := NewUnstartedExporter(WithStalenessMarkers(true))
+	exp.metricExporter = msc
+	exp.started = true
+
+	clock := time.Unix(6000, 0)
+	exp.now = func() time.Time { return clock }
+	ctx := context.Background()
+	host := key.String("host", "test.com")
+
+	require.NoError(t, exp.Export(ctx, nil, doubleCounterCheckpoint(t, "bytes-sent", 1.5, host)))
+	msc.Reset()
+	// Dropping the only series leaves nothing live, but a stale marker for
+	// bytes-sent should still be emitted.
+	require.NoError(t, exp.Export(ctx, nil, checkpointSet{}))
+
+	metrics := msc.ResourceMetrics()[0].InstrumentationLibraryMetrics[0].Metrics
+	require.Len(t, metrics, 1)
+	require.Len(t, metrics[0].DoubleDataPoints, 1)
+	assert.True(t, math.IsNaN(metrics[0].DoubleDataPoints[0].Value))
+}
+
+func TestStalenessMarkersDoNotCorruptDeltaAfterReappearance(t *testing.T) {
+	msc := &metricsServiceClientStub{}
+	exp := NewUnstartedExporter(WithStalenessMarkers(true), WithTemporality(DeltaTemporality))
+	exp.metricExporter = msc
+	exp.started = true
+
+	clock := time.Unix(7000, 0)
+	exp.now = func() time.Time { return clock }
+
+	ctx := context.Background()
+	host := key.String("host", "a.test.com")
+
+	// First export establishes the series at a cumulative value of 10.
+	require.NoError(t, exp.Export(ctx, nil, counterCheckpoint(t, "requests", 10, host)))
+
+	// Second export drops the series entirely; a stale marker is emitted and
+	// the adjuster must forget the series rather than keep its pre-gap
+	// value of 10 to diff against.
+	msc.Reset()
+	clock = clock.Add(time.Second)
+	require.NoError(t, exp.Export(ctx, nil, checkpointSet{}))
+
+	// Third export: the series reappears with its cumulative value having
+	// advanced to 13 since it was last truly observed. The emitted delta
+	// must reflect that the adjuster treated this as a fresh series (the
+	// true increment since the gap is unknowable), not 13 minus 10.
+	msc.Reset()
+	clock = clock.Add(time.Second)
+	require.NoError(t, exp.Export(ctx, nil, counterCheckpoint(t, "requests", 13, host)))
+
+	metrics := msc.ResourceMetrics()[0].InstrumentationLibraryMetrics[0].Metrics
+	require.Len(t, metrics, 1)
+	require.Len(t, metrics[0].Int64DataPoints, 1)
+	assert.Equal(t, int64(13), metrics[0].Int64DataPoints[0].Value,
+		"reappearing series must be re-anchored, not diffed against its pre-gap value")
+}
@@ -0,0 +1,413 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	commonpb "github.com/open-telemetry/opentelemetry-proto/gen/go/common/v1"
+	metricpb "github.com/open-telemetry/opentelemetry-proto/gen/go/metrics/v1"
+	resourcepb "github.com/open-telemetry/opentelemetry-proto/gen/go/resource/v1"
+
+	"go.opentelemetry.io/otel/api/core"
+	"go.opentelemetry.io/otel/api/label"
+	"go.opentelemetry.io/otel/api/metric"
+	metricsdk "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// sumAggregator is satisfied by aggregators that support a cumulative Sum,
+// such as the SDK's sum aggregator used for CounterKind instruments.
+type sumAggregator interface {
+	Sum() (core.Number, error)
+}
+
+// minMaxSumCountAggregator is satisfied by aggregators that support the
+// distribution summary used for MeasureKind and ObserverKind instruments.
+type minMaxSumCountAggregator interface {
+	sumAggregator
+	Count() (int64, error)
+	Min() (core.Number, error)
+	Max() (core.Number, error)
+}
+
+// mergeableAggregator is satisfied by aggregators that can fold another
+// aggregator of the same kind into themselves, such as the SDK's sum and
+// minmaxsumcount aggregators. It is used to pre-aggregate records that share
+// a resource, instrumentation library, descriptor, and label set before they
+// are encoded, so that a single data point is emitted per group.
+type mergeableAggregator interface {
+	Merge(metricsdk.Aggregator, *metric.Descriptor) error
+}
+
+// record is the subset of metricsdk.Record the transform pipeline needs. It
+// is satisfied by metricsdk.Record itself and by groupedMetric, so the same
+// transformRecord logic can run over either.
+type record interface {
+	Descriptor() *metric.Descriptor
+	Labels() *label.Set
+	Aggregator() metricsdk.Aggregator
+}
+
+// groupKey identifies a group of records that share a resource (handled by
+// the caller, one per Export call), instrumentation library, descriptor, and
+// label set, and so can be merged into a single data point.
+type groupKey struct {
+	library        string
+	descriptorName string
+	metricKind     metric.Kind
+	numberKind     core.NumberKind
+	labels         label.Distinct
+}
+
+// groupedMetric is the pre-aggregated accumulator for a groupKey: the first
+// record's aggregator, with every subsequent record in the group merged in.
+type groupedMetric struct {
+	descriptor *metric.Descriptor
+	labels     *label.Set
+	aggregator metricsdk.Aggregator
+}
+
+func (g *groupedMetric) Descriptor() *metric.Descriptor   { return g.descriptor }
+func (g *groupedMetric) Labels() *label.Set               { return g.labels }
+func (g *groupedMetric) Aggregator() metricsdk.Aggregator { return g.aggregator }
+
+// groupRecords reads every record out of cps, merging the aggregators of any
+// records that share a groupKey. The returned order preserves the sequence
+// in which each key was first seen.
+func groupRecords(cps metricsdk.CheckpointSet) (map[groupKey]*groupedMetric, []groupKey, error) {
+	groups := map[groupKey]*groupedMetric{}
+	var order []groupKey
+
+	err := cps.ForEach(func(r metricsdk.Record) error {
+		desc := r.Descriptor()
+		labels := r.Labels()
+		key := groupKey{
+			library:        desc.InstrumentationName(),
+			descriptorName: desc.Name(),
+			metricKind:     desc.MetricKind(),
+			numberKind:     desc.NumberKind(),
+			labels:         labels.Equivalent(),
+		}
+
+		g, ok := groups[key]
+		if !ok {
+			groups[key] = &groupedMetric{descriptor: desc, labels: labels, aggregator: r.Aggregator()}
+			order = append(order, key)
+			return nil
+		}
+
+		merger, ok := g.aggregator.(mergeableAggregator)
+		if !ok {
+			return fmt.Errorf("otlp: aggregator for %q does not support pre-aggregation merging", desc.Name())
+		}
+		return merger.Merge(r.Aggregator(), desc)
+	})
+	return groups, order, err
+}
+
+// transformedPoint is the result of transforming a single SDK record into
+// its OTLP descriptor and data point. Exactly one of the point fields is
+// populated, depending on the instrument's MetricKind.
+type transformedPoint struct {
+	library      string
+	descriptor   *metricpb.MetricDescriptor
+	int64Point   *metricpb.Int64DataPoint
+	doublePoint  *metricpb.DoubleDataPoint
+	summaryPoint *metricpb.SummaryDataPoint
+}
+
+// libraryGroup accumulates the Metrics belonging to a single
+// InstrumentationLibrary while preserving first-seen order, which keeps
+// exporter output deterministic for a given checkpoint iteration order.
+type libraryGroup struct {
+	library *commonpb.InstrumentationLibrary
+	metrics map[string]*metricpb.Metric
+	order   []string
+}
+
+// transformCheckpointSet fans the records in cps out across workerCount
+// goroutines for encoding, then groups the resulting points by
+// instrumentation library and descriptor into a single ResourceMetrics. It
+// returns a nil ResourceMetrics if cps contained no records.
+//
+// Unless withoutPreAggregation is set, records sharing a resource (one per
+// Export call), instrumentation library, descriptor, and label set are
+// merged into a single aggregator before encoding, so exactly one data point
+// is emitted per group. With withoutPreAggregation, every record is encoded
+// as its own data point, even when several share a group.
+func transformCheckpointSet(ctx context.Context, res *resource.Resource, cps metricsdk.CheckpointSet, workerCount int, withoutPreAggregation bool) (*metricpb.ResourceMetrics, error) {
+	if workerCount < 1 {
+		workerCount = DefaultWorkerCount
+	}
+
+	records := make(chan record, workerCount)
+	results := make(chan transformResult, workerCount)
+
+	var workers sync.WaitGroup
+	workers.Add(workerCount)
+	for i := 0; i < workerCount; i++ {
+		go func() {
+			defer workers.Done()
+			for r := range records {
+				point, err := transformRecord(r)
+				results <- transformResult{point: point, err: err}
+			}
+		}()
+	}
+
+	var forEachErr error
+	go func() {
+		defer close(records)
+		if withoutPreAggregation {
+			forEachErr = cps.ForEach(func(r metricsdk.Record) error {
+				select {
+				case records <- r:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+			return
+		}
+
+		groups, order, err := groupRecords(cps)
+		if err != nil {
+			forEachErr = err
+			return
+		}
+		for _, key := range order {
+			select {
+			case records <- groups[key]:
+			case <-ctx.Done():
+				forEachErr = ctx.Err()
+				return
+			}
+		}
+	}()
+
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	groups := map[string]*libraryGroup{}
+	var groupOrder []string
+	var firstErr error
+	for result := range results {
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			continue
+		}
+		g, ok := groups[result.point.library]
+		if !ok {
+			g = &libraryGroup{metrics: map[string]*metricpb.Metric{}}
+			if result.point.library != "" {
+				g.library = &commonpb.InstrumentationLibrary{Name: result.point.library}
+			}
+			groups[result.point.library] = g
+			groupOrder = append(groupOrder, result.point.library)
+		}
+		g.addPoint(result.point)
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if forEachErr != nil {
+		return nil, forEachErr
+	}
+	if len(groupOrder) == 0 {
+		return nil, nil
+	}
+
+	ilms := make([]*metricpb.InstrumentationLibraryMetrics, 0, len(groupOrder))
+	for _, name := range groupOrder {
+		g := groups[name]
+		metrics := make([]*metricpb.Metric, 0, len(g.order))
+		for _, key := range g.order {
+			metrics = append(metrics, g.metrics[key])
+		}
+		ilms = append(ilms, &metricpb.InstrumentationLibraryMetrics{
+			InstrumentationLibrary: g.library,
+			Metrics:                metrics,
+		})
+	}
+
+	return &metricpb.ResourceMetrics{
+		Resource:                      transformResource(res),
+		InstrumentationLibraryMetrics: ilms,
+	}, nil
+}
+
+// transformResult carries a worker's output back to the grouping goroutine.
+type transformResult struct {
+	point transformedPoint
+	err   error
+}
+
+// addPoint appends point's data point to the Metric matching its
+// descriptor, creating the Metric on first use.
+func (g *libraryGroup) addPoint(point transformedPoint) {
+	key := point.descriptor.String()
+	m, ok := g.metrics[key]
+	if !ok {
+		m = &metricpb.Metric{MetricDescriptor: point.descriptor}
+		g.metrics[key] = m
+		g.order = append(g.order, key)
+	}
+	switch {
+	case point.int64Point != nil:
+		m.Int64DataPoints = append(m.Int64DataPoints, point.int64Point)
+	case point.doublePoint != nil:
+		m.DoubleDataPoints = append(m.DoubleDataPoints, point.doublePoint)
+	case point.summaryPoint != nil:
+		m.SummaryDataPoints = append(m.SummaryDataPoints, point.summaryPoint)
+	}
+}
+
+// transformRecord converts a single SDK record into its OTLP descriptor and
+// data point, dispatching on the instrument's MetricKind.
+func transformRecord(r record) (transformedPoint, error) {
+	desc := r.Descriptor()
+	labels := r.Labels()
+
+	point := transformedPoint{
+		library:    desc.InstrumentationName(),
+		descriptor: transformDescriptor(desc, labels),
+	}
+
+	switch desc.MetricKind() {
+	case metric.CounterKind:
+		agg, ok := r.Aggregator().(sumAggregator)
+		if !ok {
+			return point, fmt.Errorf("otlp: exporter expected a sum aggregator for counter %q", desc.Name())
+		}
+		sum, err := agg.Sum()
+		if err != nil {
+			return point, err
+		}
+		if desc.NumberKind() == core.Float64NumberKind {
+			point.doublePoint = &metricpb.DoubleDataPoint{Value: sum.AsFloat64()}
+		} else {
+			point.int64Point = &metricpb.Int64DataPoint{Value: sum.AsInt64()}
+		}
+	default:
+		agg, ok := r.Aggregator().(minMaxSumCountAggregator)
+		if !ok {
+			return point, fmt.Errorf("otlp: exporter expected a min-max-sum-count aggregator for %q", desc.Name())
+		}
+		count, err := agg.Count()
+		if err != nil {
+			return point, err
+		}
+		sum, err := agg.Sum()
+		if err != nil {
+			return point, err
+		}
+		min, err := agg.Min()
+		if err != nil {
+			return point, err
+		}
+		max, err := agg.Max()
+		if err != nil {
+			return point, err
+		}
+		point.summaryPoint = &metricpb.SummaryDataPoint{
+			Count: uint64(count),
+			Sum:   sum.CoerceToFloat64(desc.NumberKind()),
+			PercentileValues: []*metricpb.SummaryDataPoint_ValueAtPercentile{
+				{Percentile: 0, Value: min.CoerceToFloat64(desc.NumberKind())},
+				{Percentile: 100, Value: max.CoerceToFloat64(desc.NumberKind())},
+			},
+		}
+	}
+	return point, nil
+}
+
+// transformDescriptor builds the OTLP MetricDescriptor for desc, including
+// labels as a sorted list of string key-values.
+func transformDescriptor(desc *metric.Descriptor, labels *label.Set) *metricpb.MetricDescriptor {
+	return &metricpb.MetricDescriptor{
+		Name:   desc.Name(),
+		Type:   transformDescriptorType(desc),
+		Labels: transformLabels(labels),
+	}
+}
+
+func transformDescriptorType(desc *metric.Descriptor) metricpb.MetricDescriptor_Type {
+	if desc.MetricKind() != metric.CounterKind {
+		return metricpb.MetricDescriptor_SUMMARY
+	}
+	if desc.NumberKind() == core.Float64NumberKind {
+		return metricpb.MetricDescriptor_COUNTER_DOUBLE
+	}
+	return metricpb.MetricDescriptor_COUNTER_INT64
+}
+
+func transformLabels(labels *label.Set) []*commonpb.StringKeyValue {
+	if labels == nil || labels.Len() == 0 {
+		return nil
+	}
+	out := make([]*commonpb.StringKeyValue, 0, labels.Len())
+	iter := labels.Iter()
+	for iter.Next() {
+		kv := iter.Label()
+		out = append(out, &commonpb.StringKeyValue{
+			Key:   string(kv.Key),
+			Value: kv.Value.Emit(),
+		})
+	}
+	return out
+}
+
+// transformResource converts an SDK resource into its OTLP representation,
+// returning nil for a nil or empty resource so the wire format omits it.
+func transformResource(res *resource.Resource) *resourcepb.Resource {
+	if res == nil {
+		return nil
+	}
+	attrs := res.Attributes()
+	if len(attrs) == 0 {
+		return nil
+	}
+	out := make([]*commonpb.AttributeKeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		out = append(out, transformAttribute(kv))
+	}
+	return &resourcepb.Resource{Attributes: out}
+}
+
+func transformAttribute(kv core.KeyValue) *commonpb.AttributeKeyValue {
+	akv := &commonpb.AttributeKeyValue{Key: string(kv.Key)}
+	switch kv.Value.Type() {
+	case core.BOOL:
+		akv.Type = commonpb.AttributeKeyValue_BOOL
+		akv.BoolValue = kv.Value.AsBool()
+	case core.INT32, core.INT64, core.UINT32, core.UINT64:
+		akv.Type = commonpb.AttributeKeyValue_INT64
+		akv.IntValue = kv.Value.AsInt64()
+	case core.FLOAT32, core.FLOAT64:
+		akv.Type = commonpb.AttributeKeyValue_DOUBLE
+		akv.DoubleValue = kv.Value.AsFloat64()
+	default:
+		akv.Type = commonpb.AttributeKeyValue_STRING
+		akv.StringValue = kv.Value.Emit()
+	}
+	return akv
+}